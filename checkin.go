@@ -0,0 +1,257 @@
+// checkin.go implements the challenge/response flow that replaces the
+// old plaintext-token comparison in waitForCode. A check-in is now a
+// two-step exchange, mirroring how dms itself challenges the owner on
+// every clock tick: a challenge is issued (an opaque cid plus a code
+// mailed to the owner), and the owner answers it with that cid/code
+// pair. The OTP itself never needs to appear in a URL or log line.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// authReq tracks one outstanding check-in challenge.
+type authReq struct {
+	Code         string
+	CreatedAt    time.Time
+	ChallengedAt time.Time
+	Tries        int
+	VerifiedAt   time.Time
+}
+
+// checkinMaxTries caps verification attempts per challenge, so a short
+// alphanumeric code can't just be brute-forced over HTTP. The challenge
+// TTL itself is configurable via -checkin-ttl (cfg.CheckinTTL), since
+// how long an owner can take to answer a challenge depends on how
+// they're expected to receive it.
+const checkinMaxTries = 5
+
+// stateMu guards every piece of runtime state shared between the clock
+// goroutine, the check-in HTTP handlers, the inbound SMTP listener and
+// the SIGHUP reload path: the pending-challenge map, cfg.Forgive and
+// nextTick (state.go). It must never still be held by a caller when
+// saveState is invoked, since saveState takes it itself.
+var (
+	stateMu sync.Mutex
+	pending = map[string]*authReq{}
+)
+
+// generateCID returns an opaque, unguessable challenge id. Unlike the
+// code itself, it's fine for this to show up in a URL or log line: on
+// its own it grants nothing.
+func generateCID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// generateCode returns a cryptographically random alphanumeric code of
+// length n. This used to be built on math/rand, which is predictable
+// enough to make a check-in code guessable by anyone who can observe a
+// few previous ones; crypto/rand closes that.
+func generateCode(n int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	// 256 isn't a multiple of len(letters), so a plain v%len(letters)
+	// would bias the low end of the alphabet. Reject draws at or above
+	// the largest multiple of len(letters) that fits in a byte instead.
+	limit := byte(256 - 256%len(letters))
+
+	out := make([]byte, n)
+	buf := make([]byte, 1)
+	for i := 0; i < n; {
+		if _, err := rand.Read(buf); err != nil {
+			// The system CSPRNG failing means there's nothing sane left
+			// to do with a security-sensitive short code.
+			panic(err)
+		}
+		if buf[0] >= limit {
+			continue
+		}
+		out[i] = letters[int(buf[0])%len(letters)]
+		i++
+	}
+	return string(out)
+}
+
+// issueChallenge mints a new authReq, stores it under a fresh cid and
+// mails the OTP to the owner. It's used both by the periodic clock tick
+// and by the /checkin/request endpoint, so there's a single place that
+// decides what a challenge looks like.
+func issueChallenge(reason string) (cid string, err error) {
+	cid, err = generateCID()
+	if err != nil {
+		return "", err
+	}
+	code := generateCode(16)
+
+	stateMu.Lock()
+	pending[cid] = &authReq{Code: code, CreatedAt: time.Now(), ChallengedAt: time.Now()}
+	stateMu.Unlock()
+	saveState()
+
+	body := reason +
+		"\nPOST /checkin/verify with cid=" + cid + "&otp=" + code +
+		"\nOr, if you can only reach email, reply to checkin+" + code + "@" + cfg.CheckinDomain
+	if err := cfg.sendMail([]string{cfg.UserEmail}, "dms: are you still there?", body); err != nil {
+		return "", err
+	}
+	return cid, nil
+}
+
+// requestCheckin handles POST /checkin/request: it issues a fresh
+// challenge and returns the opaque cid the caller must present to
+// /checkin/verify. Useful when the owner wants to check in without
+// waiting for the next clock tick.
+func requestCheckin(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cid, err := issueChallenge("Your Dead Man's Switch here, are you still there?")
+	if err != nil {
+		http.Error(rw, "failed to issue challenge", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(struct {
+		CID string `json:"cid"`
+	}{CID: cid})
+}
+
+// verifyCheckin handles POST /checkin/verify: given a cid and otp form
+// value, it validates the code in constant time, enforces the TTL and
+// per-cid try limit, and increases Forgive on success.
+func verifyCheckin(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(rw, "bad request", http.StatusBadRequest)
+		return
+	}
+	cid := r.FormValue("cid")
+	otp := r.FormValue("otp")
+
+	// saveState takes stateMu itself, so it's never called here while
+	// still holding it: each branch below unlocks before saving.
+	stateMu.Lock()
+
+	req, ok := pending[cid]
+	if !ok {
+		stateMu.Unlock()
+		http.Error(rw, "unknown or expired challenge", http.StatusNotFound)
+		return
+	}
+	if time.Since(req.CreatedAt) > cfg.CheckinTTL {
+		delete(pending, cid)
+		stateMu.Unlock()
+		http.Error(rw, "challenge expired", http.StatusGone)
+		return
+	}
+	if req.Tries >= checkinMaxTries {
+		delete(pending, cid)
+		stateMu.Unlock()
+		http.Error(rw, "too many attempts", http.StatusTooManyRequests)
+		return
+	}
+	req.Tries++
+
+	if subtle.ConstantTimeCompare([]byte(otp), []byte(req.Code)) != 1 {
+		stateMu.Unlock()
+		saveState()
+		http.Error(rw, "invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	req.VerifiedAt = time.Now()
+	delete(pending, cid)
+	cfg.Forgive += 1
+	stateMu.Unlock()
+	saveState()
+
+	fmt.Fprintln(rw, "ok")
+}
+
+// codeAttemptLimit and codeAttemptWindow cap how many verifyCheckinCode
+// guesses are accepted per window, independent of any individual
+// challenge's Tries. The inbound SMTP listener has no real way to
+// authenticate a sender (smtpd doesn't implement AUTH, and MAIL FROM is
+// trivially forged), so unlike the HTTP /checkin/verify path, a caller
+// here can't be trusted to only ever be guessing its own challenge. This
+// limiter protects the whole pool of outstanding challenges from being
+// brute-forced dry by a flood of guesses spread across them, instead of
+// charging the attempt to whichever challenge happened to be guessed.
+const (
+	codeAttemptLimit  = 20
+	codeAttemptWindow = time.Minute
+)
+
+var (
+	codeAttemptCount     int
+	codeAttemptWindowEnd time.Time
+)
+
+// verifyCheckinCode completes a pending challenge identified only by its
+// code, rather than by cid. Used by the inbound SMTP listener, where the
+// "checkin+<code>@domain" RCPT TO local-part doesn't carry a cid, only
+// the human-readable code the owner was mailed.
+func verifyCheckinCode(code string) bool {
+	stateMu.Lock()
+
+	now := time.Now()
+	if now.After(codeAttemptWindowEnd) {
+		codeAttemptCount = 0
+		codeAttemptWindowEnd = now.Add(codeAttemptWindow)
+	}
+	if codeAttemptCount >= codeAttemptLimit {
+		stateMu.Unlock()
+		return false
+	}
+	codeAttemptCount++
+
+	found := false
+	for cid, req := range pending {
+		if time.Since(req.CreatedAt) > cfg.CheckinTTL {
+			delete(pending, cid)
+			continue
+		}
+		// Only the challenge actually matched pays for this attempt:
+		// iterating the rest to find it isn't those challenges being
+		// guessed against, so it shouldn't count toward their Tries.
+		if subtle.ConstantTimeCompare([]byte(code), []byte(req.Code)) == 1 {
+			req.Tries++
+			req.VerifiedAt = now
+			delete(pending, cid)
+			cfg.Forgive += 1
+			found = true
+			break
+		}
+	}
+	stateMu.Unlock()
+	saveState()
+	return found
+}
+
+// checkinMux builds the handler exposing the check-in endpoints. It
+// replaces the old waitForCode, which compared a plaintext token against
+// r.RequestURI on a bare "/" handler. Returning a Handler rather than
+// listening itself lets main wrap it in an http.Server it can shut down
+// gracefully.
+func checkinMux() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/checkin/request", requestCheckin)
+	mux.HandleFunc("/checkin/verify", verifyCheckin)
+	return mux
+}
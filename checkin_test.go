@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestGenerateCodeAlphabet checks that generateCode returns codes of the
+// requested length drawn only from the OTP alphabet. It does not measure
+// the distribution, so a bias towards the low end of the alphabet would
+// not fail it.
+func TestGenerateCodeAlphabet(t *testing.T) {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	for i := 0; i < 1000; i++ {
+		code := generateCode(16)
+		if len(code) != 16 {
+			t.Fatalf("generateCode(16) length = %d, want 16", len(code))
+		}
+		for _, c := range code {
+			if !strings.ContainsRune(letters, c) {
+				t.Fatalf("generateCode produced out-of-alphabet rune %q in %q", c, code)
+			}
+		}
+	}
+}
+
+func TestGenerateCIDUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 200; i++ {
+		cid, err := generateCID()
+		if err != nil {
+			t.Fatalf("generateCID: %v", err)
+		}
+		if seen[cid] {
+			t.Fatalf("generateCID produced a duplicate: %s", cid)
+		}
+		seen[cid] = true
+	}
+}
@@ -0,0 +1,45 @@
+// combine.go implements `dms combine`, a small standalone subcommand
+// that reconstructs a Shamir-split secret from shares read on stdin,
+// one base64 share per line. It's the counterpart to the per-recipient
+// shares a triggered -threshold switch mails out.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/5amu/dms/shamir"
+)
+
+// runCombine reads shares from stdin until EOF and prints the
+// reconstructed secret.
+func runCombine() {
+	var shares []shamir.Share
+
+	fmt.Fprintln(os.Stderr, "Paste your shares, one per line, then EOF (Ctrl-D):")
+	scn := bufio.NewScanner(os.Stdin)
+	for scn.Scan() {
+		line := scn.Text()
+		if line == "" {
+			continue
+		}
+		share, err := shamir.ParseShare(line)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "combine:", err)
+			os.Exit(1)
+		}
+		shares = append(shares, share)
+	}
+	if err := scn.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, "combine:", err)
+		os.Exit(1)
+	}
+
+	secret, err := shamir.Combine(shares)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "combine:", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(secret))
+}
@@ -0,0 +1,87 @@
+// Package daemon turns dms into a well-behaved long-running process:
+// the classic four-step daemonization (fork, setsid, chdir, redirect
+// std fds), a PID file, and signal-driven graceful shutdown/reload.
+// https://ieftimov.com/post/four-steps-daemonize-your-golang-programs/
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// reexecEnv marks a process that has already re-exec'd itself into the
+// background, so Daemonize doesn't fork forever.
+const reexecEnv = "DMS_DAEMONIZED=1"
+
+// Daemonize detaches the current process from its controlling terminal:
+// fork (by re-exec'ing itself, since the Go runtime can't safely fork
+// after it's started), setsid, chdir to "/", and redirect stdin/stdout/
+// stderr to /dev/null. The parent process exits once the child starts.
+// Called again inside the child (it sees reexecEnv in its environment),
+// it's a no-op that just returns true so main() knows to carry on.
+func Daemonize() (daemonized bool, err error) {
+	for _, e := range os.Environ() {
+		if e == reexecEnv {
+			return true, nil
+		}
+	}
+
+	devnull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return false, err
+	}
+	defer devnull.Close()
+
+	cmd := exec.Command(os.Args[0], os.Args[1:]...)
+	cmd.Env = append(os.Environ(), reexecEnv)
+	cmd.Stdin = devnull
+	cmd.Stdout = devnull
+	cmd.Stderr = devnull
+	cmd.Dir = "/"
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := cmd.Start(); err != nil {
+		return false, err
+	}
+	os.Exit(0)
+	return false, nil // unreachable
+}
+
+// WritePIDFile writes the calling process's pid to path.
+func WritePIDFile(path string) error {
+	return os.WriteFile(path, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644)
+}
+
+// RemovePIDFile removes the PID file written by WritePIDFile. Errors are
+// swallowed: a missing or unremovable PID file on the way out shouldn't
+// mask the real shutdown.
+func RemovePIDFile(path string) {
+	_ = os.Remove(path)
+}
+
+// HandleSignals installs handlers for SIGTERM/SIGINT (graceful shutdown,
+// via cancel) and SIGHUP (reload, via the reload callback), and blocks
+// until ctx is done or a terminating signal arrives.
+func HandleSignals(ctx context.Context, cancel context.CancelFunc, reload func()) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-sigCh:
+			if sig == syscall.SIGHUP {
+				reload()
+				continue
+			}
+			cancel()
+			return
+		}
+	}
+}
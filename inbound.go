@@ -0,0 +1,41 @@
+// inbound.go wires the embedded SMTP listener (smtpd.Server) to the
+// check-in flow: a message to checkin+<code>@<domain> completes the
+// challenge matching <code>, exactly like POSTing to /checkin/verify,
+// for owners who can only reach email and not arbitrary HTTP endpoints.
+package main
+
+import (
+	"strings"
+
+	"github.com/5amu/dms/smtpd"
+)
+
+// checkinBackend implements smtpd.Backend by looking for the
+// "checkin+<code>" local-part convention on any RCPT TO address. smtpd
+// speaks no SMTP AUTH, and MAIL FROM is just a claim the sender makes,
+// not something smtpd verifies, so it isn't treated as authentication
+// here: the actual secret is the OTP in the local-part, rate-limited by
+// verifyCheckinCode regardless of who the envelope claims to be from.
+type checkinBackend struct{}
+
+func (checkinBackend) Accept(from string, to []string, data []byte) error {
+	for _, rcpt := range to {
+		local, _, ok := strings.Cut(rcpt, "@")
+		if !ok {
+			continue
+		}
+		prefix, code, ok := strings.Cut(local, "+")
+		if !ok || prefix != "checkin" {
+			continue
+		}
+		verifyCheckinCode(code)
+	}
+	return nil
+}
+
+// newInboundServer builds the embedded SMTP submission listener used
+// for email-based check-ins. It's returned, rather than run directly,
+// so main can hold onto it and call Close on shutdown.
+func newInboundServer(addr, hostname string) *smtpd.Server {
+	return &smtpd.Server{Addr: addr, Hostname: hostname, Backend: checkinBackend{}}
+}
@@ -0,0 +1,110 @@
+// relay.go implements direct-to-MX delivery: instead of authenticating
+// to a provider's submission server, dms resolves each recipient
+// domain's MX records itself and delivers straight to its MX hosts on
+// port 25, best preference first, the way a real MTA would. This lets dms act as its own
+// outbound relay instead of requiring a third-party SMTP account.
+package mailer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"sort"
+	"strings"
+)
+
+// SendDirect delivers msg from "from" to every address in "to" by
+// resolving each recipient domain's MX records and talking directly to
+// its hosts on port 25 in preference order, stopping at the first one
+// that accepts the message, with opportunistic STARTTLS.
+// hostname is used as the EHLO identity.
+func SendDirect(hostname, from string, to []string, msg []byte) error {
+	byDomain := make(map[string][]string)
+	for _, rcpt := range to {
+		_, domain, ok := strings.Cut(rcpt, "@")
+		if !ok {
+			return fmt.Errorf("mailer: invalid recipient %q", rcpt)
+		}
+		byDomain[domain] = append(byDomain[domain], rcpt)
+	}
+
+	for domain, rcpts := range byDomain {
+		if err := deliverToDomain(hostname, domain, from, rcpts, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliverToDomain looks up domain's MX hosts, in preference order, and
+// delivers to the first one that accepts the connection and the whole
+// transaction.
+func deliverToDomain(hostname, domain, from string, to []string, msg []byte) error {
+	mxs, err := net.LookupMX(domain)
+	if err != nil {
+		return fmt.Errorf("mailer: lookup MX for %s: %w", domain, err)
+	}
+	sort.Slice(mxs, func(i, j int) bool { return mxs[i].Pref < mxs[j].Pref })
+
+	var lastErr error
+	for _, mx := range mxs {
+		host := strings.TrimSuffix(mx.Host, ".")
+		if err := deliverToHost(hostname, host, from, to, msg); err != nil {
+			lastErr = err
+			continue
+		}
+		return nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("mailer: no MX records for %s", domain)
+	}
+	return lastErr
+}
+
+// deliverToHost opens a plain SMTP session to host:25, opportunistically
+// upgrading to TLS, and runs a single MAIL/RCPT*/DATA transaction.
+func deliverToHost(hostname, host, from string, to []string, msg []byte) error {
+	conn, err := net.Dial("tcp", net.JoinHostPort(host, "25"))
+	if err != nil {
+		return fmt.Errorf("mailer: dial %s: %w", host, err)
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return fmt.Errorf("mailer: new client: %w", err)
+	}
+	defer c.Close()
+
+	if err := c.Hello(hostname); err != nil {
+		return fmt.Errorf("mailer: ehlo: %w", err)
+	}
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("mailer: starttls: %w", err)
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return fmt.Errorf("mailer: mail from: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("mailer: rcpt to %s: %w", rcpt, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("mailer: data: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("mailer: write body: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("mailer: close body: %w", err)
+	}
+
+	return c.Quit()
+}
@@ -1,9 +1,9 @@
 // This Dead Man's Switch project has to run on a server with consistent
 // uptime, it should be running this program in the background. It will
-// send an email, then it expects an HTTP GET request with a token on
-// port 9999 on the server. If that request won't arrive in a configured
-// time span, the program will send the stored secret key to all the
-// recipients that you specified.
+// send an email with a check-in challenge, then it expects a matching
+// POST /checkin/verify on port 9999 on the server. If that request
+// won't arrive in a configured time span, the program will send the
+// stored secret key to all the recipients that you specified.
 // https://en.wikipedia.org/wiki/Dead_man%27s_switch.
 // This project is licensed under GPLv3 and v.casalino@protonmail.com is
 // the original author. Feel free to contribute, redistribute, repackage
@@ -17,18 +17,32 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"math/rand"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/mail"
-	"net/smtp"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/5amu/dms/daemon"
+	"github.com/5amu/dms/mailer"
+	"github.com/5amu/dms/shamir"
+	"github.com/5amu/dms/signing"
 )
 
+// cfgMu guards cfg.Recipients/cfg.Tick/cfg.Intervals, the fields
+// reloadFromFile rewrites on SIGHUP while clock runs concurrently in its
+// own goroutine. cfg.Forgive and nextTick have the same kind of
+// cross-goroutine sharing problem but go through stateMu (checkin.go)
+// instead, alongside the pending-challenge map they're persisted with.
+var cfgMu sync.Mutex
+
 // ClockTick is the refresh tick for the timer of the switch
 const DefaultClockTick = 24 * time.Hour
 
@@ -36,32 +50,203 @@ const DefaultClockTick = 24 * time.Hour
 // better documented later. Later on you'll find internal values
 // and variables to make the timer work.
 type config struct {
-	UserEmail   string
-	MXServer    string
-	MXPort      string
-	Recipients  string
-	Intervals   int
-	Forgive     int
-	ForgiveCode string
-	Password    string
-	Secret      string
-	Tick        time.Duration
+	UserEmail       string
+	MXServer        string
+	MXPort          string
+	Provider        string
+	STARTTLS        bool
+	Recipients      string
+	Intervals       int
+	Forgive         int
+	Password        string
+	Secret          string
+	Tick            time.Duration
+	StateFile       string
+	ConfigFile      string
+	PIDFile         string
+	Daemonize       bool
+	Hostname        string
+	Relay           bool
+	CheckinTTL      time.Duration
+	StatePassphrase string
+
+	InboundSMTP     bool
+	InboundSMTPAddr string
+	CheckinDomain   string
+
+	DKIMKeyPath  string
+	DKIMSelector string
+	DKIMDomain   string
+	DKIM         signing.Config
+
+	Threshold  string
+	ThresholdK int
+	ThresholdN int
+	Shares     []shamir.Share
 }
 
-// checks will check the sanity of the parameters passed to the
-// program. AKA the first fields in the config struct.
-func (c *config) checks() error {
+// parseThreshold parses a "-threshold k/n" value into its two integers.
+func parseThreshold(s string) (k, n int, err error) {
+	ks, ns, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("threshold: expected k/n, got %q", s)
+	}
+	if k, err = strconv.Atoi(ks); err != nil {
+		return 0, 0, fmt.Errorf("threshold: %w", err)
+	}
+	if n, err = strconv.Atoi(ns); err != nil {
+		return 0, 0, fmt.Errorf("threshold: %w", err)
+	}
+	if k < 1 || n < k {
+		return 0, 0, fmt.Errorf("threshold: invalid k/n %d/%d", k, n)
+	}
+	return k, n, nil
+}
+
+// reloadFromFile re-reads cfg.ConfigFile, if set, to pick up changes to
+// Recipients and Intervals on SIGHUP. The Forgive counter and Secret are
+// deliberately left untouched: those only ever change at ingest time or
+// on a successful check-in, never from a config reload.
+func (c *config) reloadFromFile() error {
+	if c.ConfigFile == "" {
+		return nil
+	}
+
+	f, err := os.Open(c.ConfigFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
 
-	var target = fmt.Sprint(c.MXServer, ":", c.MXPort)
+	scn := bufio.NewScanner(f)
+	for scn.Scan() {
+		line := strings.TrimSpace(scn.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "recipients":
+			recipients := strings.TrimSpace(value)
+			// In Shamir mode each recipient is already holding exactly
+			// one share, so a reload can't change how many there are
+			// without invalidating that mapping: checks() enforces
+			// recipients==n at startup, and a reload has to enforce the
+			// same or clock()'s later cfg.Shares[i] indexing panics.
+			if c.ThresholdN > 0 {
+				if n := len(strings.Split(recipients, ",")); n != c.ThresholdN {
+					return fmt.Errorf("reload: -threshold requires exactly %d recipients, got %d", c.ThresholdN, n)
+				}
+			}
+			cfgMu.Lock()
+			c.Recipients = recipients
+			cfgMu.Unlock()
+		case "interval":
+			days, err := strconv.Atoi(strings.TrimSpace(value))
+			if err == nil && days > 0 {
+				cfgMu.Lock()
+				c.Intervals = days
+				c.Tick = time.Duration(days * 24 * int(time.Hour))
+				cfgMu.Unlock()
+			}
+		}
+	}
+	return scn.Err()
+}
 
-	// Test if the host is reachable and the port is accessible
-	// with a TCP connection.
-	timeout := time.Duration(5) * time.Second
+// mailerConfig builds a mailer.Config from the flags/preset the user
+// chose. A known -provider preset fills in the host/port/TLS mode;
+// "custom" (the default) falls back to -mxserv/-mxport, defaulting to
+// implicit TLS unless -starttls was passed.
+func (c *config) mailerConfig() mailer.Config {
+	host, port, tlsMode := c.MXServer, c.MXPort, mailer.ImplicitTLS
+	if c.STARTTLS {
+		tlsMode = mailer.STARTTLS
+	}
 
-	if _, err := net.DialTimeout("tcp", target, timeout); err != nil {
+	if preset, ok := mailer.Presets[c.Provider]; ok {
+		host, port, tlsMode = preset.Host, preset.Port, preset.TLSMode
+	}
+
+	return mailer.Config{
+		Host:     host,
+		Port:     port,
+		Username: c.UserEmail,
+		Password: c.Password,
+		TLSMode:  tlsMode,
+	}
+}
+
+// sendMail builds a proper RFC 5322 message for subject/body, DKIM-
+// signing it when -dkim-key is configured, then delivers it either
+// through the configured provider (mailer.Send) or, with -relay,
+// straight to each recipient's MX host (mailer.SendDirect) so dms can
+// act as its own outbound relay instead of needing a third-party SMTP
+// account. If signing is configured and fails, the mail is not sent.
+func (c *config) sendMail(to []string, subject, body string) error {
+	msg, err := signing.Build(signing.Message{
+		From:      c.UserEmail,
+		To:        to,
+		Subject:   subject,
+		Body:      body,
+		MessageID: fmt.Sprintf("<%d@%s>", time.Now().UnixNano(), c.Hostname),
+		Date:      time.Now(),
+	}, c.DKIM)
+	if err != nil {
+		return err
+	}
+
+	if c.Relay {
+		return mailer.SendDirect(c.Hostname, c.UserEmail, to, msg)
+	}
+	return mailer.Send(c.mailerConfig(), c.UserEmail, to, msg)
+}
+
+// loadDKIMKey reads and parses the RSA or Ed25519 private key at
+// c.DKIMKeyPath, if set, populating c.DKIM so every outgoing message is
+// signed from then on.
+func (c *config) loadDKIMKey() error {
+	if c.DKIMKeyPath == "" {
+		return nil
+	}
+
+	pemBytes, err := os.ReadFile(c.DKIMKeyPath)
+	if err != nil {
+		return fmt.Errorf("dkim: read key: %w", err)
+	}
+	rsaKey, edKey, err := signing.ParsePrivateKeyPEM(pemBytes)
+	if err != nil {
 		return err
 	}
 
+	c.DKIM = signing.Config{PrivateKey: rsaKey, Ed25519Key: edKey, Selector: c.DKIMSelector, Domain: c.DKIMDomain}
+	return nil
+}
+
+// checks will check the sanity of the parameters passed to the
+// program. AKA the first fields in the config struct.
+func (c *config) checks() error {
+
+	// Test if the host is reachable and the port is accessible with a
+	// TCP connection. The target is derived from mailerConfig(), so a
+	// -provider preset (or -mxserv/-mxport directly) is probed rather
+	// than always dialing the raw MXServer/MXPort fields, which are
+	// never filled in when a preset is selected. With -relay, dms
+	// delivers straight to each recipient's MX host instead of a single
+	// configured server, so there's no single target to probe here;
+	// mailerConfig() and sendMail will surface any delivery problem.
+	if !c.Relay {
+		target := net.JoinHostPort(c.mailerConfig().Host, c.mailerConfig().Port)
+		timeout := time.Duration(5) * time.Second
+
+		if _, err := net.DialTimeout("tcp", target, timeout); err != nil {
+			return err
+		}
+	}
+
 	// Parse sender and recipient email addresses as RFC 5322
 	// compliant addresses thanks to this package
 	// https://golang.org/pkg/net/mail/
@@ -74,15 +259,36 @@ func (c *config) checks() error {
 		return err
 	}
 
+	// In Shamir mode, every recipient gets exactly one share, so the
+	// recipient count must match n exactly: more and some recipients
+	// get nothing, fewer and some share is never delivered.
+	if c.Threshold != "" {
+		k, n, err := parseThreshold(c.Threshold)
+		if err != nil {
+			return err
+		}
+		c.ThresholdK, c.ThresholdN = k, n
+
+		numRecipients := len(strings.Split(c.Recipients, ","))
+		if numRecipients != n {
+			return fmt.Errorf("checks: -threshold %s requires exactly %d recipients, got %d", c.Threshold, n, numRecipients)
+		}
+	}
+
+	// Loading the DKIM key here, before the test mail, means a
+	// misconfigured key fails checks() immediately instead of silently
+	// falling back to unsigned mail on the first real trigger.
+	if err := c.loadDKIMKey(); err != nil {
+		return err
+	}
+
 	// Sending a test mail to ensure the correct credentials
 	// and move on. You don't want to spend the first interval
 	// of the time wondering if you used the correct credentials
-	// or you mistyped something.
-	// https://golang.org/pkg/net/smtp/#PlainAuth
-	auth := smtp.PlainAuth("", c.UserEmail, c.Password, target)
-	testMsg := []byte("Test to check your credentials. Have a nice day :)")
-
-	if err := smtp.SendMail(target, auth, c.UserEmail, []string{c.UserEmail}, testMsg); err != nil {
+	// or you mistyped something. This goes through the mailer
+	// package so STARTTLS/AUTH negotiation (and, if configured, DKIM
+	// signing) is exercised up front, not just a raw TCP dial.
+	if err := c.sendMail([]string{c.UserEmail}, "dms: credentials check", "Test to check your credentials. Have a nice day :)"); err != nil {
 		return err
 	}
 
@@ -121,6 +327,19 @@ func (c *config) getSecret() error {
 	// Stores it in the config struct.
 	c.Secret = strings.Join(lines, "\n")
 
+	// In Shamir mode, split the secret into per-recipient shares right
+	// away and drop the plaintext: from here on only the shares are
+	// ever kept or persisted, so a single compromised recipient mailbox
+	// can't leak the whole secret.
+	if c.Threshold != "" {
+		shares, err := shamir.Split([]byte(c.Secret), c.ThresholdK, c.ThresholdN)
+		if err != nil {
+			return err
+		}
+		c.Shares = shares
+		c.Secret = ""
+	}
+
 	return nil
 }
 
@@ -148,6 +367,15 @@ func flagParse() {
 	flag.StringVar(&cfg.MXServer, "mxserv", "", "Mail Server for sending emails")
 	flag.StringVar(&cfg.MXPort, "mxport", "465", "Port for email sending")
 
+	// provider picks one of the built-in presets (host/port/TLS mode) so
+	// users don't have to look up their server's quirks by hand. Leave
+	// it unset (or "custom") to fall back to -mxserv/-mxport/-starttls.
+	// -starttls is the only switch for the custom provider: unset, it
+	// dials straight into TLS (as used on port 465); set, it dials in
+	// clear text and upgrades after EHLO (as used on port 587).
+	flag.StringVar(&cfg.Provider, "provider", "custom", "Mail provider preset: gmail, outlook, protonmail or custom")
+	flag.BoolVar(&cfg.STARTTLS, "starttls", false, "Dial in clear text and upgrade with STARTTLS, instead of implicit TLS (custom provider only)")
+
 	// recipients are the ones that you want to deliver your secret to.
 	// those are the email addresses to whom your secret will be sent
 	// if your switch will be triggered. Choose carefully.
@@ -160,6 +388,63 @@ func flagParse() {
 	flag.IntVar(&cfg.Intervals, "interval", 0, "Interval (days) for the switch")
 	flag.IntVar(&cfg.Forgive, "forgive", 1, "Tries before actually sending emails")
 
+	// statefile is where the Secret, Forgive counter, pending check-in
+	// challenges and next tick deadline are persisted, encrypted with a
+	// key derived from -state-passphrase (falling back to -password, so
+	// existing setups aren't broken), so a restart doesn't need the
+	// secret piped in over stdin again.
+	flag.StringVar(&cfg.StateFile, "statefile", "/var/lib/dms/state.enc", "Where to persist encrypted runtime state")
+
+	// state-passphrase is a dedicated secret for the state file, distinct
+	// from -password: -password can be empty (eg. under -relay, where
+	// there's no SMTP account to authenticate), in which case falling
+	// back to it would derive a well-known sha256("") key and leave
+	// cfg.Secret trivially recoverable from disk. Without either set,
+	// saveState refuses to persist the plaintext secret at all.
+	flag.StringVar(&cfg.StatePassphrase, "state-passphrase", "", "Passphrase to encrypt persisted state (falls back to -password if unset)")
+
+	// configfile, when set, is re-read on SIGHUP to pick up new
+	// recipients/interval without restarting the daemon.
+	flag.StringVar(&cfg.ConfigFile, "configfile", "", "Config file (recipients=.../interval=...) reloaded on SIGHUP")
+
+	// daemonize detaches the process from the terminal; pidfile is
+	// where its pid is recorded so it can be signaled later.
+	flag.BoolVar(&cfg.Daemonize, "daemonize", false, "Detach from the terminal and run in the background")
+	flag.StringVar(&cfg.PIDFile, "pidfile", "/var/run/dms.pid", "Where to write the daemon's PID file")
+
+	// hostname is the EHLO identity used both when relaying mail
+	// directly and when talking to the inbound SMTP listener.
+	flag.StringVar(&cfg.Hostname, "hostname", "localhost", "EHLO identity for outbound/inbound SMTP")
+
+	// checkin-ttl controls how long an issued check-in challenge stays
+	// valid before it must be re-issued.
+	flag.DurationVar(&cfg.CheckinTTL, "checkin-ttl", 15*time.Minute, "How long an issued check-in challenge stays valid")
+
+	// relay bypasses any provider/preset and delivers straight to each
+	// recipient's MX host, so dms can be its own outbound relay instead
+	// of needing a third-party SMTP account.
+	flag.BoolVar(&cfg.Relay, "relay", false, "Deliver directly to recipient MX hosts instead of a provider")
+
+	// The embedded inbound SMTP listener lets the owner check in by
+	// mailing checkin+<code>@checkindomain, for when only email (not
+	// arbitrary HTTP) is reachable.
+	flag.BoolVar(&cfg.InboundSMTP, "inbound-smtp", false, "Run an embedded SMTP listener for email check-ins")
+	flag.StringVar(&cfg.InboundSMTPAddr, "inbound-smtp-addr", ":2525", "Address for the embedded inbound SMTP listener")
+	flag.StringVar(&cfg.CheckinDomain, "checkin-domain", "", "Domain advertised for checkin+<code>@domain email check-ins")
+
+	// DKIM-signing outgoing mail: unset -dkim-key leaves mail unsigned,
+	// same as before; setting it makes a misconfigured key fail checks()
+	// instead of quietly shipping unsigned trigger mail.
+	flag.StringVar(&cfg.DKIMKeyPath, "dkim-key", "", "PEM-encoded RSA or Ed25519 private key to DKIM-sign outgoing mail")
+	flag.StringVar(&cfg.DKIMSelector, "dkim-selector", "dms", "DKIM selector")
+	flag.StringVar(&cfg.DKIMDomain, "dkim-domain", "", "DKIM signing domain (d=)")
+
+	// threshold switches to Shamir's secret sharing: instead of mailing
+	// the whole secret to every recipient, each of the n recipients gets
+	// one share, and any k of them must combine theirs (via `dms
+	// combine`) to recover it.
+	flag.StringVar(&cfg.Threshold, "threshold", "", "Shamir threshold k/n: split the secret across n recipients, any k reconstruct it")
+
 	flag.Usage = func() {
 		fmt.Fprint(os.Stdout, "Activate a Dead Man's Switch. Your reason, your business :)\n\n")
 		flag.PrintDefaults()
@@ -167,21 +452,13 @@ func flagParse() {
 	flag.Parse()
 }
 
-// generateCode will generate the alphanumeric code that has to be supplied
-// to the http endpoint to increase the Forgive counter
-func generateCode(n int) string {
-	var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
-	s := make([]rune, n)
-	for i := range s {
-		s[i] = letters[rand.Intn(len(letters))]
-	}
-	return string(s)
-}
-
 // clock is the effective clock of the program. Its purpose is to
 // react to time changes by triggering the switch when time passes
-// and the target isn't "alive".
-func clock(ctx context.Context, cfg *config) error {
+// and the target isn't "alive". It takes a *time.Ticker, rather than
+// time.Tick, so a SIGHUP reload can call ticker.Reset and have a
+// changed interval actually take effect.
+func clock(ctx context.Context, cfg *config, ticker *time.Ticker) error {
+	first := true
 	for {
 		select {
 		// When the context is killed, or done, this will just
@@ -189,89 +466,218 @@ func clock(ctx context.Context, cfg *config) error {
 		case <-ctx.Done():
 			return nil
 		// This will be triggered at every ClockTick
-		case <-time.Tick(cfg.Tick):
+		case <-ticker.C:
+			// The first tick may have been seeded from a restored
+			// nextTick deadline and so run short (or long); every tick
+			// after it follows the regular cfg.Tick cadence. cfg.Tick can
+			// change concurrently via a SIGHUP reload, so it's read under
+			// cfgMu rather than trusting the value seen at clock startup.
+			cfgMu.Lock()
+			tick := cfg.Tick
+			recipientsCSV := cfg.Recipients
+			cfgMu.Unlock()
+
+			if first {
+				first = false
+				ticker.Reset(tick)
+			}
+
+			stateMu.Lock()
 			cfg.Forgive -= 1
+			forgive := cfg.Forgive
+			stateMu.Unlock()
+
 			// If the user is not answering for whatever reason after the
 			// n times defined by Forgive, then trigger the dead man switch
-			if cfg.Forgive < 0 {
+			if forgive < 0 {
+				subject := cfg.UserEmail + "'s Dead Man's Switch has triggered"
+
+				// In Shamir mode, no single recipient gets the whole
+				// secret: each gets only their own share, and the switch
+				// explains that k of them need to combine shares with
+				// `dms combine` to recover it.
+				if len(cfg.Shares) > 0 {
+					recipients := strings.Split(recipientsCSV, ",")
+					// reloadFromFile rejects a recipient count that
+					// doesn't match -threshold's n, but bound the loop
+					// by it anyway rather than trust that rejection is
+					// the only way cfg.Recipients could ever drift.
+					if len(recipients) > len(cfg.Shares) {
+						recipients = recipients[:len(cfg.Shares)]
+					}
+					for i, r := range recipients {
+						body := fmt.Sprintf(
+							"%s's Dead Man's Switch here. This is 1 of %d shares; "+
+								"any %d of them, combined with `dms combine`, reconstruct the secret.\n\n%s",
+							cfg.UserEmail, cfg.ThresholdN, cfg.ThresholdK, cfg.Shares[i].String(),
+						)
+						if err := cfg.sendMail([]string{strings.TrimSpace(r)}, subject, body); err != nil {
+							return err
+						}
+					}
+					return nil
+				}
+
 				// Send email to each wmail in recipients variable
-				auth := smtp.PlainAuth("", cfg.UserEmail, cfg.Password, cfg.MXServer)
-				msg := []byte(cfg.UserEmail + "'s Dead Man's Switch here, the secret is" + cfg.Secret)
-				if err := smtp.SendMail(cfg.MXServer+":"+cfg.MXPort, auth, cfg.UserEmail, strings.Split(cfg.Recipients, ","), msg); err != nil {
+				body := cfg.UserEmail + "'s Dead Man's Switch here, the secret is " + cfg.Secret
+				if err := cfg.sendMail(strings.Split(recipientsCSV, ","), subject, body); err != nil {
 					return err
 				}
 				return nil
 			}
-			// If the user has more tries, then generate a new code and send it to
-			// its own mailbox with the code to use
-			cfg.ForgiveCode = generateCode(16)
-			auth := smtp.PlainAuth("", cfg.UserEmail, cfg.Password, cfg.MXServer)
-			msg := []byte("Your Dead Man's Switch here, are you still there? Make a request: http://server:9999/" + cfg.ForgiveCode)
-			if err := smtp.SendMail(cfg.MXServer+":"+cfg.MXPort, auth, cfg.UserEmail, []string{cfg.UserEmail}, msg); err != nil {
+			// If the user has more tries, issue a fresh check-in challenge:
+			// this stores the OTP server-side and mails it, instead of the
+			// old plaintext token embedded directly in a GET URL.
+			stateMu.Lock()
+			nextTick = time.Now().Add(tick)
+			stateMu.Unlock()
+			if _, err := issueChallenge("Your Dead Man's Switch here, are you still there?"); err != nil {
 				return err
 			}
 		}
 	}
 }
 
-// waitForCode will start a http server, waiting for the code as GET
-// parameter, if it receives it, then increases the Forgive value, so that
-// the time limit increases
-func waitForCode() error {
-
-	http.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
-		if cfg.ForgiveCode != "" && r.RequestURI == cfg.ForgiveCode {
-			cfg.Forgive += 1
-			cfg.ForgiveCode = ""
-		}
-	})
+func main() {
 
-	if err := http.ListenAndServe(":9999", nil); err != nil {
-		return err
+	// `dms combine` is a standalone subcommand, not part of the daemon:
+	// it reconstructs a Shamir-split secret from shares and exits.
+	if len(os.Args) > 1 && os.Args[1] == "combine" {
+		runCombine()
+		return
 	}
 
-	return nil
-}
-
-func main() {
-
 	// Parse flags, it is not optimal, but works... eg. It will
 	// print an usage only if the flah -h or -help is specified
 	flagParse()
 
-	// This banner should be colored in the future, for now,
-	// let's just make this program work without hiccups
-	banner()
+	if cfg.Daemonize {
+		daemonized, err := daemon.Daemonize()
+		if err != nil {
+			slog.Error("daemonize", "err", err)
+			os.Exit(1)
+		}
+		if !daemonized {
+			// The parent re-exec'd a detached child and its job here is
+			// done; Daemonize has already called os.Exit(0) for it, so
+			// this branch is unreachable, but guard it anyway.
+			return
+		}
+	} else {
+		// This banner should be colored in the future, for now,
+		// let's just make this program work without hiccups. Skipped
+		// when daemonized since nothing is attached to read it.
+		banner()
+	}
+
+	if err := daemon.WritePIDFile(cfg.PIDFile); err != nil {
+		slog.Error("write pidfile", "path", cfg.PIDFile, "err", err)
+		os.Exit(1)
+	}
+	defer daemon.RemovePIDFile(cfg.PIDFile)
 
 	// This will make sure that all arguments are present and
 	// correctly passed to the program. Will also check the
 	// connections to the Mail eXchange Server
 	if err := cfg.checks(); err != nil {
-		panic(err)
+		slog.Error("checks failed", "err", err)
+		os.Exit(1)
 	}
 
-	// This reads the secret from stdin and stores it in the
-	// config struct as message body for the dead man switch
-	if err := cfg.getSecret(); err != nil {
-		panic(err)
+	// Restore the Secret, Forgive counter, pending challenges and next
+	// tick deadline from a previous run, if any were persisted.
+	if err := loadState(); err != nil {
+		slog.Error("load state", "err", err)
+		os.Exit(1)
+	}
+
+	// Only prompt for the secret over stdin if we didn't just restore
+	// one (plaintext or, in Shamir mode, shares) from disk.
+	if cfg.Secret == "" && len(cfg.Shares) == 0 {
+		if err := cfg.getSecret(); err != nil {
+			slog.Error("get secret", "err", err)
+			os.Exit(1)
+		}
 	}
+	saveState()
 
 	// Defining a context for aborting execution gracefully
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Starting the HTTP server as go routine. This won't stop
-	// execution of the next instructions
+	// Starting the HTTP server as its own goroutine, with Shutdown
+	// wired to the context instead of leaking the listener goroutine
+	// once the program is asked to stop.
+	srv := &http.Server{Addr: ":9999", Handler: checkinMux()}
 	go func() {
-		if err := waitForCode(); err != nil {
-			panic(err)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("checkin server", "err", err)
+			cancel()
 		}
 	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer shutdownCancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("checkin server shutdown", "err", err)
+		}
+	}()
+
+	if cfg.InboundSMTP {
+		inboundSrv := newInboundServer(cfg.InboundSMTPAddr, cfg.Hostname)
+		go func() {
+			if err := inboundSrv.ListenAndServe(); err != nil && !errors.Is(err, net.ErrClosed) {
+				slog.Error("inbound smtp server", "err", err)
+				cancel()
+			}
+		}()
+		go func() {
+			<-ctx.Done()
+			if err := inboundSrv.Close(); err != nil {
+				slog.Error("inbound smtp server shutdown", "err", err)
+			}
+		}()
+	}
+
+	// Seed the first tick from the restored nextTick deadline, if any,
+	// rather than always starting a fresh cfg.Tick from now: otherwise a
+	// restart right before the deadline would silently grant the owner
+	// a whole extra interval. clock() resets the ticker to the regular
+	// cfg.Tick cadence once this first, possibly shorter, tick fires.
+	initialTick := cfg.Tick
+	if !nextTick.IsZero() {
+		if d := time.Until(nextTick); d > 0 {
+			initialTick = d
+		} else {
+			initialTick = time.Nanosecond
+		}
+	}
+	ticker := time.NewTicker(initialTick)
+	defer ticker.Stop()
+
+	// SIGTERM/SIGINT cancel ctx for a graceful shutdown; SIGHUP reloads
+	// recipients/interval from -configfile without losing the Forgive
+	// counter or Secret, and resets the ticker so a changed interval
+	// actually takes effect.
+	go daemon.HandleSignals(ctx, cancel, func() {
+		if err := cfg.reloadFromFile(); err != nil {
+			slog.Error("reload config", "err", err)
+			return
+		}
+		cfgMu.Lock()
+		tick, recipients := cfg.Tick, cfg.Recipients
+		cfgMu.Unlock()
+		ticker.Reset(tick)
+		saveState()
+		slog.Info("config reloaded", "recipients", recipients, "tick", tick)
+	})
 
-	// This section enstablishes a context and starts the clock and
-	// panics if an error is returned.
+	// This section starts the clock and logs an error if one is
+	// returned.
 	// https://ieftimov.com/post/four-steps-daemonize-your-golang-programs/
-	if err := clock(ctx, &config{}); err != nil {
-		panic(err)
+	if err := clock(ctx, &cfg, ticker); err != nil {
+		slog.Error("clock", "err", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,154 @@
+// Package shamir implements Shamir's secret sharing over GF(2^8), byte
+// by byte: split a secret into n shares such that any k of them
+// reconstruct it via Lagrange interpolation, but any k-1 reveal nothing
+// about it.
+package shamir
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Share is one recipient's share of a secret: their x-coordinate and
+// the corresponding y-value for every byte of the secret.
+type Share struct {
+	X byte
+	Y []byte
+}
+
+// String encodes the share as base64(X || Y), convenient for pasting
+// into an email or a terminal.
+func (s Share) String() string {
+	return base64.StdEncoding.EncodeToString(append([]byte{s.X}, s.Y...))
+}
+
+// ParseShare decodes a share previously produced by Share.String.
+func ParseShare(s string) (Share, error) {
+	buf, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return Share{}, fmt.Errorf("shamir: decode share: %w", err)
+	}
+	if len(buf) < 2 {
+		return Share{}, fmt.Errorf("shamir: share too short")
+	}
+	return Share{X: buf[0], Y: buf[1:]}, nil
+}
+
+// Split divides secret into n shares such that any k of them
+// reconstruct it, via a degree-(k-1) polynomial per byte whose constant
+// term is that byte, evaluated at x = 1..n.
+func Split(secret []byte, k, n int) ([]Share, error) {
+	if k < 1 || n < k || n > 255 {
+		return nil, fmt.Errorf("shamir: invalid threshold %d/%d", k, n)
+	}
+
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i] = Share{X: byte(i + 1), Y: make([]byte, len(secret))}
+	}
+
+	coeffs := make([]byte, k)
+	for byteIdx, secretByte := range secret {
+		coeffs[0] = secretByte
+		if k > 1 {
+			if _, err := rand.Read(coeffs[1:]); err != nil {
+				return nil, err
+			}
+		}
+		for i := range shares {
+			shares[i].Y[byteIdx] = evalPoly(coeffs, shares[i].X)
+		}
+	}
+	return shares, nil
+}
+
+// Combine reconstructs the secret from k or more shares via Lagrange
+// interpolation at x=0. All shares must carry the same number of bytes.
+func Combine(shares []Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("shamir: no shares given")
+	}
+	for _, s := range shares {
+		if len(s.Y) != len(shares[0].Y) {
+			return nil, fmt.Errorf("shamir: mismatched share lengths")
+		}
+	}
+
+	secret := make([]byte, len(shares[0].Y))
+	for byteIdx := range secret {
+		var acc byte
+		for j := range shares {
+			acc = addField(acc, mulField(shares[j].Y[byteIdx], lagrangeBasisAtZero(shares, j)))
+		}
+		secret[byteIdx] = acc
+	}
+	return secret, nil
+}
+
+// evalPoly evaluates the polynomial with the given coefficients
+// (coeffs[0] is the constant term) at x, over GF(2^8), via Horner's
+// method.
+func evalPoly(coeffs []byte, x byte) byte {
+	var result byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		result = addField(mulField(result, x), coeffs[i])
+	}
+	return result
+}
+
+// lagrangeBasisAtZero computes the j-th Lagrange basis polynomial for
+// shares, evaluated at x=0, over GF(2^8).
+func lagrangeBasisAtZero(shares []Share, j int) byte {
+	num, den := byte(1), byte(1)
+	xj := shares[j].X
+	for m := range shares {
+		if m == j {
+			continue
+		}
+		xm := shares[m].X
+		num = mulField(num, xm)
+		// Subtraction is the same as addition (XOR) in GF(2^8).
+		den = mulField(den, addField(xm, xj))
+	}
+	return mulField(num, invField(den))
+}
+
+func addField(a, b byte) byte { return a ^ b }
+
+// mulField multiplies two elements of GF(2^8), reducing by the AES
+// irreducible polynomial x^8+x^4+x^3+x+1 (0x11b).
+func mulField(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8 && a != 0 && b != 0; i++ {
+		if b&1 != 0 {
+			p ^= a
+		}
+		hiBitSet := a & 0x80
+		a <<= 1
+		if hiBitSet != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+// invField returns the multiplicative inverse of a in GF(2^8) via
+// Fermat's little theorem: the field's 255 non-zero elements form a
+// group, so a^254 == a^-1.
+func invField(a byte) byte {
+	if a == 0 {
+		return 0
+	}
+	result, base, exp := byte(1), a, 254
+	for exp > 0 {
+		if exp&1 == 1 {
+			result = mulField(result, base)
+		}
+		base = mulField(base, base)
+		exp >>= 1
+	}
+	return result
+}
@@ -0,0 +1,121 @@
+package shamir
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSplitCombineRoundTrip(t *testing.T) {
+	secret := []byte("the quick brown fox jumps over the lazy dog")
+
+	cases := []struct {
+		name   string
+		k, n   int
+		useAll bool
+		subset []int
+	}{
+		{name: "k=1 single share", k: 1, n: 3, useAll: false, subset: []int{0}},
+		{name: "k=n all shares", k: 5, n: 5, useAll: true},
+		{name: "k<n exact threshold subset", k: 3, n: 5, subset: []int{0, 2, 4}},
+		{name: "k<n non-sequential subset", k: 3, n: 6, subset: []int{1, 3, 5}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			shares, err := Split(secret, c.k, c.n)
+			if err != nil {
+				t.Fatalf("Split: %v", err)
+			}
+			if len(shares) != c.n {
+				t.Fatalf("Split returned %d shares, want %d", len(shares), c.n)
+			}
+
+			var subset []Share
+			if c.useAll {
+				subset = shares
+			} else {
+				for _, i := range c.subset {
+					subset = append(subset, shares[i])
+				}
+			}
+
+			got, err := Combine(subset)
+			if err != nil {
+				t.Fatalf("Combine: %v", err)
+			}
+			if !bytes.Equal(got, secret) {
+				t.Errorf("Combine round-trip = %q, want %q", got, secret)
+			}
+		})
+	}
+}
+
+func TestCombineBelowThresholdDoesNotReconstruct(t *testing.T) {
+	secret := []byte("sensitive payload")
+	shares, err := Split(secret, 3, 5)
+	if err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+
+	// Combine doesn't know k, so it happily runs on a k-1 subset; it just
+	// shouldn't, by construction, ever reconstruct the real secret from
+	// too few shares (that's the whole point of the scheme).
+	got, err := Combine(shares[:2])
+	if err != nil {
+		t.Fatalf("Combine: %v", err)
+	}
+	if bytes.Equal(got, secret) {
+		t.Error("Combine reconstructed the secret from fewer than k shares")
+	}
+}
+
+func TestSplitInvalidThreshold(t *testing.T) {
+	cases := []struct {
+		name string
+		k, n int
+	}{
+		{"k<1", 0, 3},
+		{"n<k", 3, 2},
+		{"n>255", 2, 256},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := Split([]byte("x"), c.k, c.n); err == nil {
+				t.Errorf("Split(%d, %d) succeeded, want error", c.k, c.n)
+			}
+		})
+	}
+}
+
+func TestCombineMismatchedLengths(t *testing.T) {
+	_, err := Combine([]Share{{X: 1, Y: []byte{1, 2}}, {X: 2, Y: []byte{1}}})
+	if err == nil {
+		t.Error("Combine accepted shares of mismatched lengths")
+	}
+}
+
+func TestCombineNoShares(t *testing.T) {
+	if _, err := Combine(nil); err == nil {
+		t.Error("Combine accepted an empty share list")
+	}
+}
+
+func TestShareStringParseRoundTrip(t *testing.T) {
+	share := Share{X: 7, Y: []byte{0x01, 0x02, 0xff, 0x00}}
+	parsed, err := ParseShare(share.String())
+	if err != nil {
+		t.Fatalf("ParseShare: %v", err)
+	}
+	if parsed.X != share.X || !bytes.Equal(parsed.Y, share.Y) {
+		t.Errorf("ParseShare(share.String()) = %+v, want %+v", parsed, share)
+	}
+}
+
+func TestParseShareInvalid(t *testing.T) {
+	if _, err := ParseShare("not valid base64!!"); err == nil {
+		t.Error("ParseShare accepted invalid base64")
+	}
+	if _, err := ParseShare(""); err == nil {
+		t.Error("ParseShare accepted an empty string")
+	}
+}
@@ -0,0 +1,179 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalizeBodySimple(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty body is a single CRLF", "", "\r\n"},
+		{"trailing blank lines stripped", "hello\r\n\r\n\r\n", "hello\r\n"},
+		{"missing final CRLF appended", "hello\r\nworld", "hello\r\nworld\r\n"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := canonicalizeBodySimple(c.in); got != c.want {
+				t.Errorf("canonicalizeBodySimple(%q) = %q, want %q", c.in, got, c.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeHeaderValueRelaxed(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"  hello   world  ", "hello world"},
+		{"a\r\n b", "a b"},
+		{"single", "single"},
+	}
+	for _, c := range cases {
+		if got := canonicalizeHeaderValueRelaxed(c.in); got != c.want {
+			t.Errorf("canonicalizeHeaderValueRelaxed(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestBuildUnsignedOmitsDKIMHeader(t *testing.T) {
+	msg := Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "hi", Body: "hello"}
+	out, err := Build(msg, Config{})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if strings.Contains(string(out), "DKIM-Signature") {
+		t.Errorf("unsigned Build() output contains a DKIM-Signature header:\n%s", out)
+	}
+}
+
+// TestBuildRSASignatureVerifies and TestBuildEd25519SignatureVerifies
+// build a signed message, independently reconstruct the signing digest
+// the same way dkimSignature does, and verify the resulting b= tag
+// against it, against a known public key. A bug that silently signs the
+// wrong header bytes (e.g. a canonicalization mismatch between the signed
+// headers and the ones in the rendered message) would fail this even
+// though Build itself returns no error. The bh= body hash is not
+// recomputed here.
+func TestBuildRSASignatureVerifies(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	cfg := Config{PrivateKey: key, Selector: "dms", Domain: "example.com"}
+	digest, sig := signAndExtract(t, cfg)
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest, sig); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+}
+
+func TestBuildEd25519SignatureVerifies(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	cfg := Config{Ed25519Key: priv, Selector: "dms", Domain: "example.com"}
+	digest, sig := signAndExtract(t, cfg)
+	if !ed25519.Verify(pub, digest, sig) {
+		t.Error("signature does not verify")
+	}
+}
+
+// signAndExtract builds a signed message with cfg and returns both the
+// signing digest and the decoded b= signature, reconstructed the same
+// way dkimSignature computes them, so the caller can verify them against
+// the key that signed them.
+func signAndExtract(t *testing.T, cfg Config) (digest, sig []byte) {
+	t.Helper()
+
+	msg := Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "hi", Body: "hello world"}
+	out, err := Build(msg, cfg)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(string(out)))
+	if err != nil {
+		t.Fatalf("mail.ReadMessage: %v", err)
+	}
+	dkimHeader := parsed.Header.Get("DKIM-Signature")
+	if dkimHeader == "" {
+		t.Fatal("signed Build() output is missing a DKIM-Signature header")
+	}
+
+	tagWithoutB, sigB64, ok := strings.Cut(dkimHeader, "b=")
+	if !ok {
+		t.Fatalf("DKIM-Signature header has no b= tag: %q", dkimHeader)
+	}
+	sig, err = base64.StdEncoding.DecodeString(strings.TrimSpace(sigB64))
+	if err != nil {
+		t.Fatalf("decode b=: %v", err)
+	}
+
+	var signingInput strings.Builder
+	for _, name := range signedHeaders {
+		signingInput.WriteString(strings.ToLower(name) + ":" + canonicalizeHeaderValueRelaxed(parsed.Header.Get(name)) + "\r\n")
+	}
+	signingInput.WriteString("dkim-signature:" + canonicalizeHeaderValueRelaxed(tagWithoutB+"b="))
+
+	sum := sha256.Sum256([]byte(signingInput.String()))
+	return sum[:], sig
+}
+
+func TestParsePrivateKeyPEM(t *testing.T) {
+	t.Run("PKCS1 RSA", func(t *testing.T) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("GenerateKey: %v", err)
+		}
+		block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+		rsaKey, edKey, err := ParsePrivateKeyPEM(pem.EncodeToMemory(block))
+		if err != nil {
+			t.Fatalf("ParsePrivateKeyPEM: %v", err)
+		}
+		if edKey != nil {
+			t.Errorf("PKCS1 RSA key parsed an Ed25519 key too: %v", edKey)
+		}
+		if rsaKey == nil || rsaKey.N.Cmp(key.N) != 0 {
+			t.Errorf("ParsePrivateKeyPEM did not round-trip the RSA key")
+		}
+	})
+
+	t.Run("PKCS8 Ed25519", func(t *testing.T) {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("GenerateKey: %v", err)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+		}
+		block := &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+		rsaKey, edKey, err := ParsePrivateKeyPEM(pem.EncodeToMemory(block))
+		if err != nil {
+			t.Fatalf("ParsePrivateKeyPEM: %v", err)
+		}
+		if rsaKey != nil {
+			t.Errorf("PKCS8 Ed25519 key parsed an RSA key too: %v", rsaKey)
+		}
+		if !priv.Public().(ed25519.PublicKey).Equal(edKey.Public().(ed25519.PublicKey)) {
+			t.Errorf("ParsePrivateKeyPEM did not round-trip the Ed25519 key")
+		}
+	})
+
+	t.Run("garbage", func(t *testing.T) {
+		if _, _, err := ParsePrivateKeyPEM([]byte("not a PEM block")); err == nil {
+			t.Error("ParsePrivateKeyPEM accepted non-PEM input")
+		}
+	})
+}
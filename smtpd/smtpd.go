@@ -0,0 +1,143 @@
+// Package smtpd implements a minimal inbound SMTP listener: just enough
+// of RFC 5321 to accept messages over a plain connection and hand each
+// to a Backend. It exists so dms can receive its own check-in signal as an
+// email, for owners who can only reach an SMTP port and not arbitrary
+// HTTP endpoints.
+package smtpd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Backend receives a fully-read message. Returning an error rejects the
+// message with a 554 after DATA.
+type Backend interface {
+	Accept(from string, to []string, data []byte) error
+}
+
+// Server is a minimal SMTP submission listener.
+type Server struct {
+	Addr     string
+	Hostname string
+	Backend  Backend
+
+	listener net.Listener
+}
+
+// ListenAndServe starts accepting connections on Addr, handling each in
+// its own goroutine, until the listener is closed via Close.
+func (s *Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	s.listener = ln
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// Close stops the listener, causing a blocked ListenAndServe to return.
+func (s *Server) Close() error {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// handle drives a single SMTP session: HELO/EHLO, then MAIL/RCPT*/DATA
+// transactions (the envelope is reset after each accepted DATA) until
+// QUIT. It's a session, not a full RFC 5321 state
+// machine: good enough for an embedded check-in mailbox, not a public
+// facing MX.
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	reply(w, "220 %s ESMTP dms", s.Hostname)
+
+	var from string
+	var to []string
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(cmd) {
+		case "HELO", "EHLO":
+			reply(w, "250 %s", s.Hostname)
+		case "MAIL":
+			from = parseAddr(arg)
+			reply(w, "250 OK")
+		case "RCPT":
+			to = append(to, parseAddr(arg))
+			reply(w, "250 OK")
+		case "DATA":
+			reply(w, "354 End data with <CR><LF>.<CR><LF>")
+			data, err := readData(r)
+			if err != nil {
+				reply(w, "451 %s", err)
+				continue
+			}
+			if err := s.Backend.Accept(from, to, data); err != nil {
+				reply(w, "554 %s", err)
+				continue
+			}
+			reply(w, "250 OK")
+			from, to = "", nil
+		case "RSET":
+			from, to = "", nil
+			reply(w, "250 OK")
+		case "QUIT":
+			reply(w, "221 Bye")
+			return
+		case "NOOP":
+			reply(w, "250 OK")
+		default:
+			reply(w, "500 unrecognized command")
+		}
+	}
+}
+
+func reply(w *bufio.Writer, format string, args ...interface{}) {
+	fmt.Fprintf(w, format+"\r\n", args...)
+	w.Flush()
+}
+
+// parseAddr strips the MAIL FROM:<...>/RCPT TO:<...> envelope syntax
+// down to the bare address.
+func parseAddr(arg string) string {
+	_, addr, ok := strings.Cut(arg, ":")
+	if !ok {
+		addr = arg
+	}
+	return strings.Trim(addr, "<>")
+}
+
+// readData reads the DATA section until the terminating "." line.
+func readData(r *bufio.Reader) ([]byte, error) {
+	var data []byte
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if line == ".\r\n" || line == ".\n" {
+			return data, nil
+		}
+		data = append(data, line...)
+	}
+}
@@ -0,0 +1,180 @@
+// state.go persists the parts of the runtime state that must survive a
+// restart (the secret, the Forgive counter, pending check-in challenges
+// and the next clock deadline) to an encrypted file, so the daemon
+// doesn't need the secret piped in over stdin again after every reboot.
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/5amu/dms/shamir"
+)
+
+// persistedState is the subset of runtime state written to disk. In
+// Shamir mode (Shares non-empty), Secret is always empty: the plaintext
+// secret never exists on disk once it's been split.
+type persistedState struct {
+	Secret   string
+	Shares   []shamir.Share
+	Forgive  int
+	Pending  map[string]*authReq
+	NextTick time.Time
+}
+
+// nextTick records the deadline of the next clock tick, so it can be
+// restored on restart instead of resetting the whole interval.
+var nextTick time.Time
+
+// stateKey derives a 32-byte AES-256 key from -state-passphrase, falling
+// back to the mail password so existing setups that only ever set
+// -password keep working. Neither is required to be set, but leaving
+// both empty means the state file is "encrypted" under the well-known
+// sha256(""), so saveState refuses to persist the plaintext Secret in
+// that case instead of pretending it's protected.
+func stateKey() [32]byte {
+	passphrase := cfg.StatePassphrase
+	if passphrase == "" {
+		passphrase = cfg.Password
+	}
+	return sha256.Sum256([]byte(passphrase))
+}
+
+// noStateKeyWarned ensures the "persisting without a state key" warning
+// is logged once rather than on every saveState call.
+var noStateKeyWarned sync.Once
+
+// saveState encrypts and writes the current runtime state to
+// cfg.StateFile. Failures are logged but not fatal: losing the ability
+// to persist shouldn't stop the switch from doing its job in memory.
+func saveState() {
+	if cfg.StateFile == "" {
+		return
+	}
+
+	stateMu.Lock()
+	secret := cfg.Secret
+	if cfg.StatePassphrase == "" && cfg.Password == "" && secret != "" {
+		// Without a dedicated passphrase or a mail password, stateKey()
+		// is sha256(""): encrypting under it buys nothing, so don't
+		// write the plaintext secret to disk at all. Shares (Shamir
+		// mode), Forgive and the pending challenges are still useful to
+		// restore and aren't secret on their own, so they're persisted
+		// regardless.
+		secret = ""
+		noStateKeyWarned.Do(func() {
+			slog.Warn("state: no -state-passphrase or -password set; the secret will not be persisted to statefile")
+		})
+	}
+	state := persistedState{
+		Secret:   secret,
+		Shares:   cfg.Shares,
+		Forgive:  cfg.Forgive,
+		Pending:  pending,
+		NextTick: nextTick,
+	}
+	// state.Pending is the live map, so it's marshaled before stateMu is
+	// released rather than while the check-in handlers may be writing it.
+	plain, err := json.Marshal(state)
+	stateMu.Unlock()
+	if err != nil {
+		slog.Error("state: marshal", "err", err)
+		return
+	}
+
+	ciphertext, err := encryptState(plain)
+	if err != nil {
+		slog.Error("state: encrypt", "err", err)
+		return
+	}
+
+	if err := os.WriteFile(cfg.StateFile, ciphertext, 0600); err != nil {
+		slog.Error("state: write", "err", err)
+	}
+}
+
+// loadState reads and decrypts cfg.StateFile, if present, restoring the
+// secret, Forgive counter, pending challenges and next tick deadline.
+// A missing file is not an error: it just means this is a first run.
+func loadState() error {
+	if cfg.StateFile == "" {
+		return nil
+	}
+
+	ciphertext, err := os.ReadFile(cfg.StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	plain, err := decryptState(ciphertext)
+	if err != nil {
+		return err
+	}
+
+	var state persistedState
+	if err := json.Unmarshal(plain, &state); err != nil {
+		return err
+	}
+
+	cfg.Secret = state.Secret
+	cfg.Shares = state.Shares
+
+	stateMu.Lock()
+	cfg.Forgive = state.Forgive
+	nextTick = state.NextTick
+	if state.Pending != nil {
+		pending = state.Pending
+	}
+	stateMu.Unlock()
+
+	return nil
+}
+
+// encryptState seals plain with AES-256-GCM under stateKey, prefixing
+// the ciphertext with the nonce used to seal it.
+func encryptState(plain []byte) ([]byte, error) {
+	key := stateKey()
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+// decryptState reverses encryptState, splitting the leading nonce back
+// off before opening the AES-256-GCM seal.
+func decryptState(data []byte) ([]byte, error) {
+	key := stateKey()
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("state: ciphertext too short")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}